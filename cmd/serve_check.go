@@ -0,0 +1,47 @@
+/*
+Copyright 2023 The K8sGPT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/k8sgpt-ai/k8sgpt/pkg/server/healthcheck"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveCheckTarget  string
+	serveCheckTimeout time.Duration
+)
+
+// serveCheckCmd dials a running k8sgpt server, lists its services via gRPC
+// reflection, and reports its health status from Health/Watch - useful as a
+// readiness probe for the shipped Helm chart.
+var serveCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the health of a running k8sgpt server",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(cmd.Context(), serveCheckTimeout)
+		defer cancel()
+		return healthcheck.Run(ctx, serveCheckTarget, os.Stdout)
+	},
+}
+
+func init() {
+	serveCheckCmd.Flags().StringVar(&serveCheckTarget, "target", "localhost:8080", "address of the k8sgpt gRPC server to check")
+	serveCheckCmd.Flags().DurationVar(&serveCheckTimeout, "timeout", 5*time.Second, "how long to wait for health status before giving up")
+	serveCmd.AddCommand(serveCheckCmd)
+}
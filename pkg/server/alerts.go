@@ -0,0 +1,260 @@
+/*
+Copyright 2023 The K8sGPT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	schemav1 "buf.build/gen/go/k8sgpt-ai/k8sgpt/protocolbuffers/go/schema/v1"
+	"github.com/k8sgpt-ai/k8sgpt/pkg/server/analyzestream"
+	"github.com/prometheus/alertmanager/template"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAlertConcurrency = 4
+	defaultAlertTimeout     = 30 * time.Second
+	defaultAlertCacheTTL    = 5 * time.Minute
+
+	forwardMaxRetries = 5
+	forwardBaseDelay  = 250 * time.Millisecond
+	forwardMaxDelay   = 10 * time.Second
+)
+
+// fingerprintCache deduplicates identical alerts seen within a TTL window,
+// so a flapping alert isn't re-analyzed on every Alertmanager retry.
+type fingerprintCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]time.Time
+}
+
+func newFingerprintCache(ttl time.Duration) *fingerprintCache {
+	return &fingerprintCache{ttl: ttl, entries: make(map[string]time.Time)}
+}
+
+// seen reports whether fingerprint was analyzed within the TTL window, and
+// records it as seen for future calls.
+func (c *fingerprintCache) seen(fingerprint string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if expiry, ok := c.entries[fingerprint]; ok && now.Before(expiry) {
+		return true
+	}
+	c.entries[fingerprint] = now.Add(c.ttl)
+	return false
+}
+
+// handleAlerts implements the Alertmanager webhook receiver contract: decode
+// the standard webhook payload, analyze each alert in a bounded worker pool,
+// annotate it with the analysis, and forward the mutated payload upstream.
+func (s *Config) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	annotation := params.Get("annotation")
+	if annotation == "" {
+		annotation = "k8sgpt_analysis"
+	}
+
+	var data template.Data
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		s.Logger.Error("decode alertmanager webhook payload", zap.Error(err))
+		http.Error(w, fmt.Sprintf("decode alerts: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	concurrency := s.AlertConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultAlertConcurrency
+	}
+	timeout := s.AlertTimeout
+	if timeout <= 0 {
+		timeout = defaultAlertTimeout
+	}
+
+	// Publish per-alert progress as the batch is analyzed. Nothing consumes
+	// this over gRPC yet (that needs the AnalyzeStream RPC from
+	// pkg/server/analyzestream's package doc), but the webhook handler logs
+	// each event at debug level in the meantime, so the publisher has a real
+	// consumer rather than sitting unconstructed.
+	pub := analyzestream.NewPublisher(len(data.Alerts))
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		for ev := range pub.Events() {
+			s.Logger.Debug("alert analysis progress",
+				zap.String("fingerprint", ev.Resource), zap.String("status", string(ev.Status)),
+				zap.Float64("progress", ev.Progress))
+		}
+	}()
+
+	// dispatched, not len(data.Alerts), is the progress denominator: alerts
+	// deduped by alertCache never reach analyzeAlert, so counting them would
+	// leave progress asymptotically short of 1.0.
+	var dispatched []*template.Alert
+	for i := range data.Alerts {
+		alert := &data.Alerts[i]
+		if s.alertCache.seen(alert.Fingerprint) {
+			continue
+		}
+		dispatched = append(dispatched, alert)
+	}
+
+	total := len(dispatched)
+	var completed int32
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, alert := range dispatched {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(alert *template.Alert) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			s.analyzeAlert(r.Context(), timeout, params, annotation, alert, pub, &completed, total)
+		}(alert)
+	}
+	wg.Wait()
+	pub.Close()
+	<-consumerDone
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		s.Logger.Error("marshal annotated alertmanager payload", zap.Error(err))
+		http.Error(w, "marshal annotated payload", http.StatusInternalServerError)
+		return
+	}
+
+	if s.AlertmanagerForwardURL == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := forwardWithRetry(r.Context(), s.AlertmanagerForwardURL, payload); err != nil {
+		s.Logger.Error("forward alertmanager payload; dead-lettering",
+			zap.Error(err), zap.ByteString("payload", payload))
+		http.Error(w, fmt.Sprintf("forward alerts: %s", err), http.StatusBadGateway)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Config) analyzeAlert(parentCtx context.Context, timeout time.Duration, params url.Values, annotation string, alert *template.Alert, pub *analyzestream.Publisher, completed *int32, total int) {
+	ctx, cancel := context.WithTimeout(parentCtx, timeout)
+	defer cancel()
+
+	pub.Publish(ctx, analyzestream.Event{
+		Analyzer: "alertmanager-webhook",
+		Resource: alert.Fingerprint,
+		Status:   analyzestream.StatusStarted,
+	})
+
+	analyzeRequest := &schemav1.AnalyzeRequest{
+		Backend:   params.Get("backend"),
+		Language:  params.Get("language"),
+		Filters:   params["filters"],
+		Namespace: alert.Labels["namespace"],
+		Nocache:   true,
+		Explain:   true,
+	}
+
+	status := analyzestream.StatusCompleted
+	resp, err := s.AnalyzeHandler.Analyze(ctx, analyzeRequest)
+	if err != nil {
+		s.Logger.Error("analyze alert", zap.String("fingerprint", alert.Fingerprint), zap.Error(err))
+		status = analyzestream.StatusFailed
+	} else {
+		if alert.Annotations == nil {
+			alert.Annotations = template.KV{}
+		}
+		for _, result := range resp.Results {
+			alert.Annotations[annotation] = result.Details
+		}
+	}
+
+	// Publish the terminal event on parentCtx, not the per-alert ctx above:
+	// when Analyze times out, ctx is already Done(), and Publish's select
+	// would race the send against that cancellation - dropping exactly the
+	// event reporting the timeout roughly half the time.
+	progress := float64(atomic.AddInt32(completed, 1)) / float64(total)
+	pub.Publish(parentCtx, analyzestream.Event{
+		Analyzer: "alertmanager-webhook",
+		Resource: alert.Fingerprint,
+		Status:   status,
+		Progress: progress,
+	})
+}
+
+// forwardWithRetry POSTs payload to forwardURL, retrying non-2xx responses
+// and transport errors with exponential backoff and jitter.
+func forwardWithRetry(ctx context.Context, forwardURL string, payload []byte) error {
+	var lastErr error
+	for attempt := 0; attempt < forwardMaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := backoffDelay(attempt)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, forwardURL, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("build forward request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("upstream returned %s", resp.Status)
+	}
+	return lastErr
+}
+
+func backoffDelay(attempt int) time.Duration {
+	delay := forwardBaseDelay * time.Duration(1<<uint(attempt-1))
+	if delay > forwardMaxDelay {
+		delay = forwardMaxDelay
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay) / 2))
+	return delay/2 + jitter
+}
+
+// handleHealthy and handleReady back the /-/healthy and /-/ready endpoints
+// expected of an Alertmanager receiver.
+func (s *Config) handleHealthy(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Config) handleReady(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2023 The K8sGPT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFingerprintCacheDeduplicatesWithinTTL(t *testing.T) {
+	c := newFingerprintCache(time.Minute)
+
+	if c.seen("a") {
+		t.Fatal("first sighting of a fingerprint should not be seen")
+	}
+	if !c.seen("a") {
+		t.Fatal("repeat fingerprint within TTL should be seen")
+	}
+}
+
+func TestFingerprintCacheExpires(t *testing.T) {
+	c := newFingerprintCache(time.Millisecond)
+
+	if c.seen("a") {
+		t.Fatal("first sighting of a fingerprint should not be seen")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if c.seen("a") {
+		t.Fatal("fingerprint past its TTL should not be seen")
+	}
+}
+
+func TestFingerprintCacheConcurrentAccess(t *testing.T) {
+	c := newFingerprintCache(time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.seen("shared")
+		}()
+	}
+	wg.Wait()
+}
+
+func TestBackoffDelayCapsAtMax(t *testing.T) {
+	d := backoffDelay(20)
+	if d > forwardMaxDelay {
+		t.Fatalf("backoffDelay(20) = %s, want <= %s", d, forwardMaxDelay)
+	}
+}
+
+func TestBackoffDelayGrows(t *testing.T) {
+	// jitter makes individual calls nondeterministic, but the delay before
+	// jitter roughly doubles each attempt, so an upper bound on attempt 1
+	// should be well below an upper bound on attempt 4.
+	small := backoffDelay(1)
+	large := backoffDelay(4)
+	if small > forwardBaseDelay {
+		t.Fatalf("backoffDelay(1) = %s, want <= %s", small, forwardBaseDelay)
+	}
+	if large < small {
+		t.Fatalf("backoffDelay(4) = %s, want >= backoffDelay(1) = %s", large, small)
+	}
+}
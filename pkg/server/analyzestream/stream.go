@@ -0,0 +1,85 @@
+/*
+Copyright 2023 The K8sGPT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package analyzestream provides a channel of per-analyzer progress events
+// that the analyzer pipeline can publish to as each analyzer finishes, so a
+// consumer can surface incremental results instead of waiting for the whole
+// run to complete.
+//
+// SCOPE: this package does NOT implement the AnalyzeStream server-streaming
+// RPC (with a gRPC-gateway text/event-stream mapping, consumed by the
+// alertmanager webhook and CLI) that was originally requested. That RPC
+// requires adding a method to the ServerAnalyzerService proto
+// (buf.build/gen/go/...), which is generated from a schema that lives
+// outside this repository and cannot be regenerated or vendored here.
+// What exists instead is this event/Publisher plumbing, consumed today only
+// by an in-process logger in the alertmanager webhook (pkg/server/alerts.go)
+// - a reduced-scope increment, not the streaming RPC. Wiring an actual
+// AnalyzeStream handler onto a consumer of Events still requires the schema
+// change above.
+package analyzestream
+
+import "context"
+
+// Status is the lifecycle state of a single analyzer's run, reported on an
+// Event.
+type Status string
+
+const (
+	StatusStarted   Status = "started"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// Event is a single analyzer's progress update within an analysis run.
+type Event struct {
+	Analyzer string
+	Resource string
+	Status   Status
+	Details  string
+	// Progress is the fraction of the run's work items that have completed,
+	// in [0, 1]. The alertmanager webhook counts alerts, not analyzers.
+	Progress float64
+}
+
+// Publisher fans progress events out to a buffered channel. A producer calls
+// Publish for each update and a consumer ranges over Events until Close. The
+// only producer is the alertmanager webhook, which publishes as each alert
+// starts and finishes; the analyzer pipeline does not publish to it.
+type Publisher struct {
+	events chan Event
+}
+
+// NewPublisher creates a Publisher with the given channel buffer size.
+func NewPublisher(buffer int) *Publisher {
+	return &Publisher{events: make(chan Event, buffer)}
+}
+
+// Events returns the channel of published events.
+func (p *Publisher) Events() <-chan Event {
+	return p.events
+}
+
+// Publish sends ev, respecting ctx cancellation so a disconnected streaming
+// client doesn't block the analyzer pipeline.
+func (p *Publisher) Publish(ctx context.Context, ev Event) {
+	select {
+	case p.events <- ev:
+	case <-ctx.Done():
+	}
+}
+
+// Close signals that no further events will be published.
+func (p *Publisher) Close() {
+	close(p.events)
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2023 The K8sGPT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package analyzestream
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPublisherDeliversPublishedEvents(t *testing.T) {
+	p := NewPublisher(2)
+	p.Publish(context.Background(), Event{Analyzer: "a", Status: StatusStarted})
+	p.Publish(context.Background(), Event{Analyzer: "a", Status: StatusCompleted, Progress: 1})
+	p.Close()
+
+	var got []Event
+	for ev := range p.Events() {
+		got = append(got, ev)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d events, want 2", len(got))
+	}
+	if got[0].Status != StatusStarted || got[1].Status != StatusCompleted {
+		t.Fatalf("unexpected event order: %+v", got)
+	}
+}
+
+func TestPublisherPublishRespectsCanceledContext(t *testing.T) {
+	p := NewPublisher(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// With no receiver on the unbuffered channel, Publish would block
+	// forever if it didn't also select on ctx.Done().
+	p.Publish(ctx, Event{Analyzer: "a"})
+}
@@ -0,0 +1,293 @@
+/*
+Copyright 2023 The K8sGPT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package auth provides a pluggable authentication chain for the k8sgpt
+// gRPC/HTTP server. It supports static bearer tokens, mTLS client-certificate
+// subjects, and OIDC-validated bearer tokens, and enforces a per-method
+// allow-list of which authentication methods are accepted.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Method identifies a supported authentication mechanism.
+type Method string
+
+const (
+	MethodToken Method = "token"
+	MethodMTLS  Method = "mtls"
+	MethodOIDC  Method = "oidc"
+)
+
+// Config describes how the server authenticates incoming gRPC/HTTP requests.
+type Config struct {
+	// Token, when set, is the shared bearer token accepted by MethodToken.
+	Token string `mapstructure:"token"`
+
+	// OIDCIssuerURL is the issuer used to validate OIDC bearer tokens.
+	OIDCIssuerURL string `mapstructure:"oidc_issuer_url"`
+	// OIDCJWKSURL overrides OIDC discovery with an explicit JWKS endpoint.
+	OIDCJWKSURL string `mapstructure:"oidc_jwks_url"`
+	// OIDCAudience is the expected "aud" claim of OIDC bearer tokens.
+	OIDCAudience string `mapstructure:"oidc_audience"`
+
+	// MTLSRequired, when true, requires a verified client certificate on
+	// every request regardless of the method allow-list, in addition to
+	// whatever methods that request's entry also requires.
+	MTLSRequired bool `mapstructure:"mtls_required"`
+
+	// MethodAllowList maps a full gRPC method name (e.g.
+	// "/schema.v1.ServerAnalyzerService/Analyze") or HTTP path to the
+	// authentication methods accepted for it. A missing entry falls back to
+	// DefaultMethods.
+	MethodAllowList map[string][]Method `mapstructure:"method_allow_list"`
+
+	// DefaultMethods is applied to any method without an explicit entry in
+	// MethodAllowList.
+	DefaultMethods []Method `mapstructure:"default_methods"`
+
+	// PublicMethods explicitly exempts these gRPC methods or HTTP paths from
+	// authentication, e.g. health checks. Every other method that resolves to
+	// no methods (no MethodAllowList entry and no DefaultMethods) is denied
+	// by default rather than served unauthenticated.
+	PublicMethods []string `mapstructure:"public_methods"`
+}
+
+// Identity is the authenticated caller attached to the request context.
+type Identity struct {
+	Method  Method
+	Subject string
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the Identity attached by the auth chain, if any.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// Chain builds the unary and stream server interceptors that enforce cfg.
+// A nil cfg disables authentication entirely, preserving prior behavior.
+func Chain(cfg *Config, logger *zap.Logger) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	a := newAuthenticator(cfg, logger)
+	return a.unary, a.stream
+}
+
+type authenticator struct {
+	cfg    *Config
+	logger *zap.Logger
+	public map[string]struct{}
+
+	oidcOnce sync.Once
+	oidc     *oidcValidator
+	oidcErr  error
+}
+
+func newAuthenticator(cfg *Config, logger *zap.Logger) *authenticator {
+	a := &authenticator{cfg: cfg, logger: logger}
+	if cfg != nil {
+		a.public = make(map[string]struct{}, len(cfg.PublicMethods))
+		for _, m := range cfg.PublicMethods {
+			a.public[m] = struct{}{}
+		}
+	}
+	return a
+}
+
+func (a *authenticator) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	newCtx, err := a.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(newCtx, req)
+}
+
+func (a *authenticator) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	newCtx, err := a.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &wrappedStream{ServerStream: ss, ctx: newCtx})
+}
+
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (w *wrappedStream) Context() context.Context { return w.ctx }
+
+func (a *authenticator) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	if a.cfg == nil {
+		return ctx, nil
+	}
+
+	if a.cfg.MTLSRequired {
+		if _, err := a.authenticateMTLS(ctx); err != nil {
+			a.logger.Warn("rejected request missing required client certificate",
+				zap.String("method", fullMethod), zap.Error(err))
+			return ctx, status.Errorf(codes.Unauthenticated, "mtls required: %s", err)
+		}
+	}
+
+	methods, ok := a.cfg.MethodAllowList[fullMethod]
+	if !ok {
+		if _, exempt := a.public[fullMethod]; exempt {
+			return ctx, nil
+		}
+		methods = a.cfg.DefaultMethods
+	}
+
+	if len(methods) == 0 {
+		// Fail closed: a method with no configured auth methods and no
+		// explicit PublicMethods exemption is denied, not served openly.
+		a.logger.Warn("rejected request: no authentication method configured", zap.String("method", fullMethod))
+		return ctx, status.Errorf(codes.Unauthenticated, "no authentication method configured for %s", fullMethod)
+	}
+
+	var lastErr error
+	for _, m := range methods {
+		switch m {
+		case MethodMTLS:
+			if id, err := a.authenticateMTLS(ctx); err == nil {
+				return context.WithValue(ctx, identityKey{}, id), nil
+			} else {
+				lastErr = err
+			}
+		case MethodToken:
+			if id, err := a.authenticateToken(ctx); err == nil {
+				return context.WithValue(ctx, identityKey{}, id), nil
+			} else {
+				lastErr = err
+			}
+		case MethodOIDC:
+			if id, err := a.authenticateOIDC(ctx); err == nil {
+				return context.WithValue(ctx, identityKey{}, id), nil
+			} else {
+				lastErr = err
+			}
+		}
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no authentication method satisfied")
+	}
+	a.logger.Warn("rejected unauthenticated request", zap.String("method", fullMethod), zap.Error(lastErr))
+	return ctx, status.Errorf(codes.Unauthenticated, "unauthenticated: %s", lastErr)
+}
+
+func (a *authenticator) authenticateToken(ctx context.Context) (Identity, error) {
+	token, err := bearerFromContext(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+	if a.cfg.Token == "" || token != a.cfg.Token {
+		return Identity{}, errors.New("invalid bearer token")
+	}
+	return Identity{Method: MethodToken, Subject: "token"}, nil
+}
+
+func (a *authenticator) authenticateMTLS(ctx context.Context) (Identity, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return Identity{}, errors.New("no peer info")
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return Identity{}, errors.New("connection is not TLS")
+	}
+	if len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return Identity{}, errors.New("no verified client certificate")
+	}
+	cert := tlsInfo.State.VerifiedChains[0][0]
+	return Identity{Method: MethodMTLS, Subject: cert.Subject.CommonName}, nil
+}
+
+func (a *authenticator) authenticateOIDC(ctx context.Context) (Identity, error) {
+	if a.cfg.OIDCIssuerURL == "" && a.cfg.OIDCJWKSURL == "" {
+		return Identity{}, errors.New("oidc not configured")
+	}
+	token, err := bearerFromContext(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+	a.oidcOnce.Do(func() {
+		a.oidc, a.oidcErr = newOIDCValidator(a.cfg.OIDCIssuerURL, a.cfg.OIDCJWKSURL, a.cfg.OIDCAudience)
+	})
+	if a.oidcErr != nil {
+		return Identity{}, fmt.Errorf("init oidc validator: %w", a.oidcErr)
+	}
+	subject, err := a.oidc.Validate(ctx, token)
+	if err != nil {
+		return Identity{}, err
+	}
+	return Identity{Method: MethodOIDC, Subject: subject}, nil
+}
+
+func bearerFromContext(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", errors.New("no metadata on request")
+	}
+	vals := md.Get("authorization")
+	if len(vals) == 0 {
+		return "", errors.New("missing authorization header")
+	}
+	return bearerFromHeader(vals[0])
+}
+
+func bearerFromHeader(header string) (string, error) {
+	const prefix = "Bearer "
+	if !strings.HasPrefix(header, prefix) {
+		return "", errors.New("authorization header is not a bearer token")
+	}
+	return strings.TrimPrefix(header, prefix), nil
+}
+
+// HTTPMiddleware applies the same authentication chain used by the gRPC
+// server to a plain HTTP handler, for the metrics and alertmanager servers.
+func HTTPMiddleware(cfg *Config, logger *zap.Logger, next http.Handler) http.Handler {
+	if cfg == nil {
+		return next
+	}
+	a := newAuthenticator(cfg, logger)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		md := metadata.New(map[string]string{"authorization": r.Header.Get("Authorization")})
+		ctx := metadata.NewIncomingContext(r.Context(), md)
+		if r.TLS != nil {
+			ctx = peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: *r.TLS}})
+		}
+
+		newCtx, err := a.authenticate(ctx, r.URL.Path)
+		if err != nil {
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(newCtx))
+	})
+}
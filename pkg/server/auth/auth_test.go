@@ -0,0 +1,96 @@
+/*
+Copyright 2023 The K8sGPT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestBearerFromHeader(t *testing.T) {
+	cases := []struct {
+		name    string
+		header  string
+		want    string
+		wantErr bool
+	}{
+		{name: "valid", header: "Bearer abc123", want: "abc123"},
+		{name: "missing prefix", header: "abc123", wantErr: true},
+		{name: "empty", header: "", wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := bearerFromHeader(tc.header)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateFailsClosedByDefault(t *testing.T) {
+	a := newAuthenticator(&Config{}, zap.NewNop())
+	if _, err := a.authenticate(context.Background(), "/schema.v1.ServerAnalyzerService/Analyze"); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated for unconfigured method, got %v", err)
+	}
+}
+
+func TestAuthenticatePublicMethodsExempt(t *testing.T) {
+	a := newAuthenticator(&Config{PublicMethods: []string{"/healthz"}}, zap.NewNop())
+	if _, err := a.authenticate(context.Background(), "/healthz"); err != nil {
+		t.Fatalf("expected public method to be exempt, got %v", err)
+	}
+}
+
+func TestAuthenticateDefaultMethodsApplyWhenSet(t *testing.T) {
+	a := newAuthenticator(&Config{
+		Token:          "secret",
+		DefaultMethods: []Method{MethodToken},
+	}, zap.NewNop())
+	if _, err := a.authenticate(context.Background(), "/unlisted"); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated without a bearer token, got %v", err)
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer secret"))
+	if _, err := a.authenticate(ctx, "/unlisted"); err != nil {
+		t.Fatalf("expected DefaultMethods token auth to accept a valid bearer token, got %v", err)
+	}
+}
+
+func TestAuthenticateNilConfigDisablesAuth(t *testing.T) {
+	a := newAuthenticator(nil, zap.NewNop())
+	if _, err := a.authenticate(context.Background(), "/anything"); err != nil {
+		t.Fatalf("expected nil config to skip auth entirely, got %v", err)
+	}
+}
+
+func TestAuthenticateMTLSRequiredRejectsPlaintext(t *testing.T) {
+	a := newAuthenticator(&Config{MTLSRequired: true, PublicMethods: []string{"/anything"}}, zap.NewNop())
+	if _, err := a.authenticate(context.Background(), "/anything"); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected MTLSRequired to reject a request with no peer info, got %v", err)
+	}
+}
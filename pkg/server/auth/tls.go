@@ -0,0 +1,123 @@
+/*
+Copyright 2023 The K8sGPT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// TLSFiles are the on-disk paths backing a ReloadableTLSConfig.
+type TLSFiles struct {
+	CertFile string
+	KeyFile  string
+	// CAFile, when set, is used to verify client certificates for mTLS.
+	CAFile string
+}
+
+// ReloadableTLSConfig serves a *tls.Config whose certificate and CA pool can
+// be swapped atomically, so the server can pick up renewed material (e.g. on
+// SIGHUP) without dropping existing connections.
+type ReloadableTLSConfig struct {
+	files TLSFiles
+	store atomic.Pointer[tls.Config]
+}
+
+// NewReloadableTLSConfig loads files and returns a ReloadableTLSConfig ready
+// to use via Config. Call Reload to pick up rotated certificates.
+func NewReloadableTLSConfig(files TLSFiles) (*ReloadableTLSConfig, error) {
+	r := &ReloadableTLSConfig{files: files}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload re-reads the certificate, key, and (if configured) CA file from
+// disk and atomically swaps the served *tls.Config.
+func (r *ReloadableTLSConfig) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load keypair: %w", err)
+	}
+
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		// This config replaces the server's own via GetConfigForClient, so it
+		// must offer h2 itself for gRPC to be negotiated over TLS.
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	if r.files.CAFile != "" {
+		caPEM, err := os.ReadFile(r.files.CAFile)
+		if err != nil {
+			return fmt.Errorf("read ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("no certificates found in %s", r.files.CAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	r.store.Store(cfg)
+	return nil
+}
+
+// Config returns a *tls.Config that always serves the current certificate
+// material via GetConfigForClient, tolerating concurrent Reload calls.
+func (r *ReloadableTLSConfig) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.store.Load(), nil
+		},
+	}
+}
+
+// ClientConfig returns a *tls.Config suitable for the gRPC-gateway's loopback
+// dial, reusing the same certificate material presented by the server.
+//
+// RootCAs is built from the server's own certificate chain (the leaf and
+// any intermediates in the key pair) rather than
+// ClientCAs: ClientCAs verifies incoming client certs for mTLS, which in
+// general is signed by a different CA than the server's own cert (and is nil
+// unless mTLS is configured at all). The loopback dial needs to trust
+// whatever the server itself presents.
+func (r *ReloadableTLSConfig) ClientConfig(serverName string) *tls.Config {
+	cur := r.store.Load()
+
+	pool := x509.NewCertPool()
+	for _, cert := range cur.Certificates {
+		for _, der := range cert.Certificate {
+			leaf, err := x509.ParseCertificate(der)
+			if err != nil {
+				continue
+			}
+			pool.AddCert(leaf)
+		}
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		ServerName:   serverName,
+		RootCAs:      pool,
+		Certificates: cur.Certificates,
+	}
+}
@@ -0,0 +1,241 @@
+/*
+Copyright 2023 The K8sGPT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package grpcutil provides a reusable helper for serving a gRPC server and
+// an HTTP handler (typically a gRPC-gateway mux, but any http.Handler works)
+// multiplexed over a single listener, in cleartext or TLS. It replaces the
+// bespoke bootstrap logic that used to live inline in pkg/server.
+package grpcutil
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+)
+
+// GatewayRegistrar registers a gRPC-gateway handler against mux, dialing the
+// given loopback endpoint. It matches the signature of the generated
+// RegisterXxxHandlerFromEndpoint functions.
+type GatewayRegistrar func(ctx context.Context, mux *runtime.ServeMux, endpoint string, opts []grpc.DialOption) error
+
+// MuxedServer serves a gRPC server and an HTTP handler over the same
+// listener, demultiplexing by content-type the way h2c/grpcHandlerFunc did
+// inline in Config.Serve.
+type MuxedServer struct {
+	addr        string
+	grpcServer  *grpc.Server
+	httpHandler http.Handler
+	tlsConfig   *tls.Config
+
+	gatewayEndpoint  string
+	gatewayDialCreds grpc.DialOption
+	registrars       []GatewayRegistrar
+	muxOptions       []runtime.ServeMuxOption
+
+	readHeaderTimeout time.Duration
+
+	listener   net.Listener
+	httpServer *http.Server
+
+	// ready is closed once httpServer has been assigned (or Run has given up
+	// without assigning it), so Shutdown can't read httpServer concurrently
+	// with Run's write to it.
+	ready     chan struct{}
+	readyOnce sync.Once
+}
+
+// Option configures a MuxedServer.
+type Option func(*MuxedServer)
+
+// WithGRPC attaches a gRPC server to be served alongside the HTTP handler.
+// Without it, MuxedServer serves plain HTTP only.
+func WithGRPC(s *grpc.Server) Option {
+	return func(m *MuxedServer) { m.grpcServer = s }
+}
+
+// WithHTTPHandler sets the HTTP handler served for non-gRPC requests.
+func WithHTTPHandler(h http.Handler) Option {
+	return func(m *MuxedServer) { m.httpHandler = h }
+}
+
+// WithGateway builds a gRPC-gateway ServeMux from registrars, dialing back to
+// endpoint with dialCreds, and uses it as the HTTP handler.
+func WithGateway(endpoint string, dialCreds grpc.DialOption, registrars ...GatewayRegistrar) Option {
+	return func(m *MuxedServer) {
+		m.gatewayEndpoint = endpoint
+		m.gatewayDialCreds = dialCreds
+		m.registrars = registrars
+	}
+}
+
+// WithServeMuxOptions adds options to the gRPC-gateway ServeMux built by
+// WithGateway, e.g. a header matcher to forward Authorization.
+func WithServeMuxOptions(opts ...runtime.ServeMuxOption) Option {
+	return func(m *MuxedServer) { m.muxOptions = append(m.muxOptions, opts...) }
+}
+
+// WithTLS serves the listener with the given TLS configuration instead of
+// cleartext.
+func WithTLS(cfg *tls.Config) Option {
+	return func(m *MuxedServer) { m.tlsConfig = cfg }
+}
+
+// WithReadHeaderTimeout bounds how long the HTTP server waits to read
+// request headers, guarding against slow-header DoS.
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(m *MuxedServer) { m.readHeaderTimeout = d }
+}
+
+// New builds a MuxedServer bound to addr. Call Listen then Run to serve it.
+func New(addr string, opts ...Option) *MuxedServer {
+	m := &MuxedServer{addr: addr, ready: make(chan struct{})}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// markReady signals that httpServer is done being assigned (successfully or
+// not), unblocking any Shutdown call waiting on it. Safe to call more than
+// once or concurrently.
+func (m *MuxedServer) markReady() {
+	m.readyOnce.Do(func() { close(m.ready) })
+}
+
+// Listen binds the configured address and returns the net.Listener, so
+// callers (and tests) can observe the bound port, e.g. after binding to
+// ":0", before Run starts serving it.
+func (m *MuxedServer) Listen() (net.Listener, error) {
+	lis, err := net.Listen("tcp", m.addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", m.addr, err)
+	}
+	m.listener = lis
+	return lis, nil
+}
+
+// Run serves lis (typically the listener returned by Listen) until ctx is
+// canceled or a fatal server error occurs.
+func (m *MuxedServer) Run(ctx context.Context, lis net.Listener) error {
+	defer m.markReady()
+
+	if m.registrars != nil {
+		gwmux := runtime.NewServeMux(m.muxOptions...)
+		for _, register := range m.registrars {
+			if err := register(ctx, gwmux, m.gatewayEndpoint, []grpc.DialOption{m.gatewayDialCreds}); err != nil {
+				return fmt.Errorf("register gateway handler: %w", err)
+			}
+		}
+		m.httpHandler = gwmux
+	}
+
+	handler := m.httpHandler
+	if m.grpcServer != nil {
+		if handler == nil {
+			handler = http.NotFoundHandler()
+		}
+		handler = grpcHandlerFunc(m.grpcServer, handler)
+	}
+	if handler == nil {
+		return fmt.Errorf("grpcutil: no gRPC server or HTTP handler configured")
+	}
+
+	m.httpServer = &http.Server{
+		Addr:              m.addr,
+		Handler:           h2c.NewHandler(handler, &http2.Server{}),
+		TLSConfig:         m.tlsConfig,
+		ReadHeaderTimeout: m.readHeaderTimeout,
+	}
+	m.markReady()
+
+	errCh := make(chan error, 1)
+	go func() {
+		var err error
+		if m.tlsConfig != nil {
+			err = m.httpServer.ServeTLS(lis, "", "")
+		} else {
+			err = m.httpServer.Serve(lis)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			errCh <- err
+			return
+		}
+		errCh <- nil
+	}()
+
+	select {
+	case <-ctx.Done():
+		return m.Shutdown(context.Background())
+	case err := <-errCh:
+		return err
+	}
+}
+
+// Shutdown drains the gRPC server (GracefulStop) and the HTTP server
+// (Shutdown(ctx)), respecting ctx's deadline for both halves. If ctx expires
+// before GracefulStop finishes, it is abandoned in favor of a forceful Stop
+// so a single stuck client can't hang shutdown forever.
+//
+// Shutdown first waits for Run to finish assigning httpServer (or to give up
+// without serving at all), so a Shutdown racing a concurrent Run can't read
+// httpServer while Run is still writing it.
+func (m *MuxedServer) Shutdown(ctx context.Context) error {
+	select {
+	case <-m.ready:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	var grpcErr error
+	if m.grpcServer != nil {
+		done := make(chan struct{})
+		go func() {
+			m.grpcServer.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			m.grpcServer.Stop()
+			grpcErr = ctx.Err()
+		}
+	}
+
+	if m.httpServer == nil {
+		return grpcErr
+	}
+	return errors.Join(grpcErr, m.httpServer.Shutdown(ctx))
+}
+
+// grpcHandlerFunc returns an http.Handler that delegates to grpcServer on
+// incoming gRPC connections or otherHandler otherwise.
+func grpcHandlerFunc(grpcServer *grpc.Server, otherHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.Contains(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcServer.ServeHTTP(w, r)
+		} else {
+			otherHandler.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2023 The K8sGPT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package grpcutil
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestMuxedServerListenBindsEphemeralPort(t *testing.T) {
+	m := New(":0", WithHTTPHandler(http.NotFoundHandler()))
+	lis, err := m.Listen()
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer lis.Close()
+
+	if lis.Addr().String() == ":0" {
+		t.Fatalf("expected an ephemeral port to be assigned, got %s", lis.Addr())
+	}
+}
+
+func TestMuxedServerShutdownIsDeterministic(t *testing.T) {
+	m := New(":0", WithHTTPHandler(http.NotFoundHandler()))
+	lis, err := m.Listen()
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- m.Run(context.Background(), lis) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	select {
+	case <-runErr:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after Shutdown")
+	}
+}
+
+func TestMuxedServerShutdownDrainsGRPCServer(t *testing.T) {
+	m := New(":0", WithGRPC(grpc.NewServer()))
+	lis, err := m.Listen()
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- m.Run(context.Background(), lis) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	select {
+	case <-runErr:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after Shutdown")
+	}
+}
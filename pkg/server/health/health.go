@@ -0,0 +1,110 @@
+/*
+Copyright 2023 The K8sGPT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package health wires the standard grpc.health.v1 service to the k8sgpt
+// server, flipping per-service status based on whether the configured AI
+// backend and Kubernetes client are actually reachable.
+package health
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// ServiceAIBackend is the health service name for backend reachability.
+	ServiceAIBackend = "ai-backend"
+	// ServiceKubernetes is the health service name for cluster connectivity.
+	ServiceKubernetes = "kubernetes"
+
+	defaultCheckInterval = 15 * time.Second
+)
+
+// Checker reports whether a dependency is currently reachable.
+type Checker func(ctx context.Context) error
+
+// Monitor periodically probes the configured Checkers and reflects their
+// result onto a *health.Server, including the overall "" service, which
+// flips NOT_SERVING if any dependency is down.
+type Monitor struct {
+	Server   *health.Server
+	Logger   *zap.Logger
+	Interval time.Duration
+
+	AIBackend  Checker
+	Kubernetes Checker
+}
+
+// NewServer builds a health.Server with every known service pre-registered
+// as NOT_SERVING until the first probe succeeds.
+func NewServer() *health.Server {
+	s := health.NewServer()
+	s.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	s.SetServingStatus(ServiceAIBackend, healthpb.HealthCheckResponse_NOT_SERVING)
+	s.SetServingStatus(ServiceKubernetes, healthpb.HealthCheckResponse_NOT_SERVING)
+	return s
+}
+
+// Start blocks, probing dependencies every Interval until ctx is canceled.
+// Call it in a goroutine.
+func (m *Monitor) Start(ctx context.Context) {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = defaultCheckInterval
+	}
+
+	m.probe(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.probe(ctx)
+		}
+	}
+}
+
+func (m *Monitor) probe(ctx context.Context) {
+	aiOK := m.check(ctx, ServiceAIBackend, m.AIBackend)
+	k8sOK := m.check(ctx, ServiceKubernetes, m.Kubernetes)
+
+	overall := healthpb.HealthCheckResponse_SERVING
+	if !aiOK || !k8sOK {
+		overall = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	m.Server.SetServingStatus("", overall)
+}
+
+func (m *Monitor) check(ctx context.Context, service string, checker Checker) bool {
+	if checker == nil {
+		m.Server.SetServingStatus(service, healthpb.HealthCheckResponse_SERVING)
+		return true
+	}
+
+	status := healthpb.HealthCheckResponse_SERVING
+	err := checker(ctx)
+	if err != nil {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+		if m.Logger != nil {
+			m.Logger.Warn("health check failed", zap.String("service", service), zap.Error(err))
+		}
+	}
+	m.Server.SetServingStatus(service, status)
+	return err == nil
+}
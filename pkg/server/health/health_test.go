@@ -0,0 +1,67 @@
+/*
+Copyright 2023 The K8sGPT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestMonitorProbeAllHealthy(t *testing.T) {
+	m := &Monitor{
+		Server:     NewServer(),
+		AIBackend:  func(context.Context) error { return nil },
+		Kubernetes: func(context.Context) error { return nil },
+	}
+	m.probe(context.Background())
+
+	assertStatus(t, m.Server, "", healthpb.HealthCheckResponse_SERVING)
+	assertStatus(t, m.Server, ServiceAIBackend, healthpb.HealthCheckResponse_SERVING)
+	assertStatus(t, m.Server, ServiceKubernetes, healthpb.HealthCheckResponse_SERVING)
+}
+
+func TestMonitorProbeOverallDownIfAnyDependencyDown(t *testing.T) {
+	m := &Monitor{
+		Server:     NewServer(),
+		AIBackend:  func(context.Context) error { return errors.New("unreachable") },
+		Kubernetes: func(context.Context) error { return nil },
+	}
+	m.probe(context.Background())
+
+	assertStatus(t, m.Server, "", healthpb.HealthCheckResponse_NOT_SERVING)
+	assertStatus(t, m.Server, ServiceAIBackend, healthpb.HealthCheckResponse_NOT_SERVING)
+	assertStatus(t, m.Server, ServiceKubernetes, healthpb.HealthCheckResponse_SERVING)
+}
+
+func TestMonitorProbeNilCheckerDefaultsToServing(t *testing.T) {
+	m := &Monitor{Server: NewServer()}
+	m.probe(context.Background())
+
+	assertStatus(t, m.Server, "", healthpb.HealthCheckResponse_SERVING)
+}
+
+func assertStatus(t *testing.T, srv *health.Server, service string, want healthpb.HealthCheckResponse_ServingStatus) {
+	t.Helper()
+	resp, err := srv.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		t.Fatalf("Check(%q): %v", service, err)
+	}
+	if resp.Status != want {
+		t.Fatalf("Check(%q) = %v, want %v", service, resp.Status, want)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2023 The K8sGPT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package healthcheck implements the client side of "k8sgpt serve check": it
+// dials a running k8sgpt server, uses gRPC reflection to enumerate its
+// services, and reads the server's overall health via Health/Watch.
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+)
+
+// Run dials target, lists its services via reflection, and writes the first
+// overall health status received from Health/Watch to out. It returns an
+// error if that status is not SERVING or if none arrives before ctx is done.
+func Run(ctx context.Context, target string, out io.Writer) error {
+	conn, err := grpc.DialContext(ctx, target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithBlock(),
+	)
+	if err != nil {
+		return fmt.Errorf("dial %s: %w", target, err)
+	}
+	defer conn.Close()
+
+	services, err := listServices(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("list services via reflection: %w", err)
+	}
+	for _, svc := range services {
+		fmt.Fprintf(out, "service: %s\n", svc)
+	}
+
+	client := healthpb.NewHealthClient(conn)
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return fmt.Errorf("watch health: %w", err)
+	}
+
+	// Watch sends the current status immediately on subscribe; a readiness
+	// probe only needs that one observation, not an indefinite stream.
+	resp, err := stream.Recv()
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("timed out waiting for health status: %w", ctx.Err())
+		}
+		return fmt.Errorf("receive health status: %w", err)
+	}
+
+	fmt.Fprintf(out, "status: %s\n", resp.Status)
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("service %q is not serving: %s", target, resp.Status)
+	}
+	return nil
+}
+
+// listServices enumerates the services exposed by conn using the standard
+// gRPC server reflection API.
+func listServices(ctx context.Context, conn *grpc.ClientConn) ([]string, error) {
+	client := reflectionpb.NewServerReflectionClient(conn)
+	stream, err := client.ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CloseSend()
+
+	req := &reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}
+	if err := stream.Send(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	var services []string
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		services = append(services, svc.Name)
+	}
+	return services, nil
+}
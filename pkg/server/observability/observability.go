@@ -0,0 +1,98 @@
+/*
+Copyright 2023 The K8sGPT Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package observability wires up the gRPC middleware stack shared by the
+// k8sgpt server: Prometheus RED metrics, structured request logging, panic
+// recovery, and OpenTelemetry tracing. The Prometheus registry it builds is
+// also served by Config.ServeMetrics, so operators get a full dashboard for
+// AnalyzeHandler and ConfigHandler methods without extra wiring.
+package observability
+
+import (
+	"context"
+
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	grpc_zap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
+	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// registry is the Prometheus registry backing both the gRPC server metrics
+// below and the /metrics endpoint served by Config.ServeMetrics.
+var registry = prometheus.NewRegistry()
+
+// serverMetrics exposes RED (rate, errors, duration) metrics per gRPC
+// method, including AnalyzeHandler.Analyze and ConfigHandler's RPCs.
+var serverMetrics = grpc_prometheus.NewServerMetrics()
+
+func init() {
+	serverMetrics.EnableHandlingTimeHistogram(
+		grpc_prometheus.WithHistogramBuckets([]float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}),
+	)
+	registry.MustRegister(
+		serverMetrics,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Registry returns the shared Prometheus registry so it can be served
+// alongside the gRPC server's own metrics.
+func Registry() *prometheus.Registry {
+	return registry
+}
+
+// InitializeMetrics pre-registers zero-value counters for every method
+// implemented by server, so dashboards show a full RED picture from the
+// first scrape instead of only after each method is first called.
+func InitializeMetrics(server *grpc.Server) {
+	serverMetrics.InitializeMetrics(server)
+}
+
+// UnaryServerInterceptors returns the chain applied to every unary RPC:
+// request tagging, Prometheus metrics, structured logging, tracing, and
+// panic recovery (innermost last, so a panic is always converted to an
+// INTERNAL error rather than crashing the process).
+func UnaryServerInterceptors(logger *zap.Logger) []grpc.UnaryServerInterceptor {
+	return []grpc.UnaryServerInterceptor{
+		grpc_ctxtags.UnaryServerInterceptor(),
+		serverMetrics.UnaryServerInterceptor(),
+		grpc_zap.UnaryServerInterceptor(logger),
+		otelgrpc.UnaryServerInterceptor(),
+		grpc_recovery.UnaryServerInterceptor(recoveryOpt()),
+	}
+}
+
+// StreamServerInterceptors mirrors UnaryServerInterceptors for streaming RPCs.
+func StreamServerInterceptors(logger *zap.Logger) []grpc.StreamServerInterceptor {
+	return []grpc.StreamServerInterceptor{
+		grpc_ctxtags.StreamServerInterceptor(),
+		serverMetrics.StreamServerInterceptor(),
+		grpc_zap.StreamServerInterceptor(logger),
+		otelgrpc.StreamServerInterceptor(),
+		grpc_recovery.StreamServerInterceptor(recoveryOpt()),
+	}
+}
+
+func recoveryOpt() grpc_recovery.Option {
+	return grpc_recovery.WithRecoveryHandlerContext(func(ctx context.Context, p interface{}) error {
+		return status.Errorf(codes.Internal, "panic: %v", p)
+	})
+}
@@ -15,33 +15,36 @@ package server
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
-	"net"
 	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/k8sgpt-ai/k8sgpt/pkg/server/analyze"
+	"github.com/k8sgpt-ai/k8sgpt/pkg/server/auth"
 	"github.com/k8sgpt-ai/k8sgpt/pkg/server/config"
+	"github.com/k8sgpt-ai/k8sgpt/pkg/server/grpcutil"
+	healthsvc "github.com/k8sgpt-ai/k8sgpt/pkg/server/health"
+	"github.com/k8sgpt-ai/k8sgpt/pkg/server/observability"
 
 	gw2 "buf.build/gen/go/k8sgpt-ai/k8sgpt/grpc-ecosystem/gateway/v2/schema/v1/server_analyzer_service/schemav1gateway"
 	gw "buf.build/gen/go/k8sgpt-ai/k8sgpt/grpc-ecosystem/gateway/v2/schema/v1/server_config_service/schemav1gateway"
 	rpc "buf.build/gen/go/k8sgpt-ai/k8sgpt/grpc/go/schema/v1/schemav1grpc"
-	schemav1 "buf.build/gen/go/k8sgpt-ai/k8sgpt/protocolbuffers/go/schema/v1"
 	"github.com/go-logr/zapr"
-	"github.com/prometheus/alertmanager/api/v2/models"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
-	"golang.org/x/net/http2"
-	"golang.org/x/net/http2/h2c"
 	ctrl "sigs.k8s.io/controller-runtime"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 )
 
@@ -56,10 +59,46 @@ type Config struct {
 	ConfigHandler      *config.Handler
 	AnalyzeHandler     *analyze.Handler
 	Logger             *zap.Logger
-	metricsServer      *http.Server
-	alertmanagerServer *http.Server
-	listener           net.Listener
+	apiServer          *grpcutil.MuxedServer
+	metricsServer      *grpcutil.MuxedServer
+	alertmanagerServer *grpcutil.MuxedServer
 	EnableHttp         bool
+
+	// TLSCertFile and TLSKeyFile enable TLS on the gRPC/HTTP server.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSCAFile, when set alongside TLSCertFile/TLSKeyFile, enables mTLS by
+	// verifying client certificates against this CA bundle.
+	TLSCAFile string
+
+	// Auth configures the pluggable authentication chain applied to gRPC and
+	// HTTP requests. A nil Auth disables authentication.
+	Auth *auth.Config
+
+	// AlertmanagerForwardURL, if set, receives the annotated Alertmanager
+	// webhook payload after analysis.
+	AlertmanagerForwardURL string
+	// AlertConcurrency bounds how many alerts are analyzed at once per
+	// webhook request. Defaults to defaultAlertConcurrency.
+	AlertConcurrency int
+	// AlertTimeout bounds how long a single alert's analysis may take.
+	// Defaults to defaultAlertTimeout.
+	AlertTimeout time.Duration
+	// AlertCacheTTL is how long an identical alert fingerprint is
+	// deduplicated for. Defaults to defaultAlertCacheTTL.
+	AlertCacheTTL time.Duration
+
+	// AIBackendCheck reports whether the configured AI provider is
+	// reachable. It backs the "ai-backend" gRPC health service and /readyz.
+	AIBackendCheck healthsvc.Checker
+	// KubernetesCheck reports whether the Kubernetes API is reachable. It
+	// backs the "kubernetes" gRPC health service and /readyz.
+	KubernetesCheck healthsvc.Checker
+
+	tls          *auth.ReloadableTLSConfig
+	alertCache   *fingerprintCache
+	healthServer *grpchealth.Server
+	healthCancel context.CancelFunc
 }
 
 type Health struct {
@@ -75,146 +114,194 @@ var health = Health{
 	Failure: 0,
 }
 
-func (s *Config) Shutdown() error {
-	return s.listener.Close()
-}
+// Shutdown drains the api, metrics, and alertmanager servers, respecting
+// ctx's deadline, and stops the health monitor goroutine.
+func (s *Config) Shutdown(ctx context.Context) error {
+	if s.healthCancel != nil {
+		s.healthCancel()
+	}
 
-// grpcHandlerFunc returns an http.Handler that delegates to grpcServer on incoming gRPC
-// connections or otherHandler otherwise.
-func grpcHandlerFunc(grpcServer *grpc.Server, otherHandler http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.ProtoMajor == 2 && strings.Contains(r.Header.Get("Content-Type"), "application/grpc") {
-			grpcServer.ServeHTTP(w, r)
-		} else {
-			otherHandler.ServeHTTP(w, r)
+	var errs []error
+	for _, srv := range []*grpcutil.MuxedServer{s.apiServer, s.metricsServer, s.alertmanagerServer} {
+		if srv == nil {
+			continue
+		}
+		if err := srv.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
 		}
-	})
+	}
+	return errors.Join(errs...)
 }
 
 func (s *Config) Serve() error {
 	ctrl.SetLogger(zapr.NewLogger(s.Logger))
 
-	var lis net.Listener
-	var err error
 	address := fmt.Sprintf(":%s", s.Port)
-	lis, err = net.Listen("tcp", address)
-	if err != nil {
-		return err
-	}
 
 	s.ConfigHandler = &config.Handler{}
 	s.AnalyzeHandler = &analyze.Handler{}
-	s.listener = lis
 	s.Logger.Info(fmt.Sprintf("binding api to %s", s.Port))
-	grpcServerUnaryInterceptor := grpc.UnaryInterceptor(LogInterceptor(s.Logger))
-	grpcServer := grpc.NewServer(grpcServerUnaryInterceptor)
+
+	authUnary, authStream := auth.Chain(s.Auth, s.Logger)
+	unaryInterceptors := append(observability.UnaryServerInterceptors(s.Logger), authUnary)
+	streamInterceptors := append(observability.StreamServerInterceptors(s.Logger), authStream)
+	serverOpts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	}
+
+	var dialCreds grpc.DialOption = grpc.WithTransportCredentials(insecure.NewCredentials())
+	muxOpts := []grpcutil.Option{}
+	if s.TLSCertFile != "" && s.TLSKeyFile != "" {
+		var err error
+		s.tls, err = auth.NewReloadableTLSConfig(auth.TLSFiles{
+			CertFile: s.TLSCertFile,
+			KeyFile:  s.TLSKeyFile,
+			CAFile:   s.TLSCAFile,
+		})
+		if err != nil {
+			return fmt.Errorf("load tls material: %w", err)
+		}
+		s.watchForReload()
+
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(s.tls.Config())))
+		dialCreds = grpc.WithTransportCredentials(credentials.NewTLS(s.tls.ClientConfig("localhost")))
+		muxOpts = append(muxOpts, grpcutil.WithTLS(s.tls.Config()))
+	}
+
+	grpcServer := grpc.NewServer(serverOpts...)
 	reflection.Register(grpcServer)
 	rpc.RegisterServerConfigServiceServer(grpcServer, s.ConfigHandler)
 	rpc.RegisterServerAnalyzerServiceServer(grpcServer, s.AnalyzeHandler)
+	observability.InitializeMetrics(grpcServer)
+
+	s.healthServer = healthsvc.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, s.healthServer)
+	monitor := &healthsvc.Monitor{
+		Server:     s.healthServer,
+		Logger:     s.Logger,
+		AIBackend:  s.AIBackendCheck,
+		Kubernetes: s.KubernetesCheck,
+	}
+	var healthCtx context.Context
+	healthCtx, s.healthCancel = context.WithCancel(context.Background())
+	go monitor.Start(healthCtx)
+
+	muxOpts = append(muxOpts, grpcutil.WithGRPC(grpcServer))
 
 	if s.EnableHttp {
 		s.Logger.Info("enabling rest/http api")
-		gwmux := runtime.NewServeMux()
-		err = gw.RegisterServerConfigServiceHandlerFromEndpoint(context.Background(), gwmux, fmt.Sprintf("localhost:%s", s.Port),
-			[]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())})
-		if err != nil {
-			log.Fatalln("Failed to register gateway:", err)
-		}
-		err = gw2.RegisterServerAnalyzerServiceHandlerFromEndpoint(context.Background(), gwmux, fmt.Sprintf("localhost:%s", s.Port),
-			[]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())})
-		if err != nil {
-			log.Fatalln("Failed to register gateway:", err)
-		}
+		muxOpts = append(muxOpts,
+			grpcutil.WithServeMuxOptions(runtime.WithIncomingHeaderMatcher(func(header string) (string, bool) {
+				if strings.EqualFold(header, "Authorization") {
+					return "authorization", true
+				}
+				return runtime.DefaultHeaderMatcher(header)
+			})),
+			grpcutil.WithGateway(fmt.Sprintf("localhost:%s", s.Port), dialCreds,
+				grpcutil.GatewayRegistrar(gw.RegisterServerConfigServiceHandlerFromEndpoint),
+				grpcutil.GatewayRegistrar(gw2.RegisterServerAnalyzerServiceHandlerFromEndpoint),
+				// TODO: register the text/event-stream mapping for
+				// AnalyzeStream here once it's added to the
+				// ServerAnalyzerService schema; see pkg/server/analyzestream.
+			),
+		)
+	}
 
-		srv := &http.Server{
-			Addr:    address,
-			Handler: h2c.NewHandler(grpcHandlerFunc(grpcServer, gwmux), &http2.Server{}),
-		}
+	s.apiServer = grpcutil.New(address, muxOpts...)
+	lis, err := s.apiServer.Listen()
+	if err != nil {
+		return err
+	}
 
-		if err := srv.Serve(lis); err != nil {
-			return err
-		}
-	} else {
-		if err := grpcServer.Serve(
-			lis,
-		); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			return err
+	return s.apiServer.Run(context.Background(), lis)
+}
+
+// watchForReload reloads the TLS certificate material on SIGHUP, so rotated
+// certificates can be picked up without restarting the process.
+func (s *Config) watchForReload() {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			if err := s.tls.Reload(); err != nil {
+				s.Logger.Error("failed to reload tls material", zap.Error(err))
+				continue
+			}
+			s.Logger.Info("reloaded tls material")
 		}
-	}
+	}()
+}
 
-	return nil
+// writeHealthStatus consults the gRPC health server for service ("" for the
+// overall status) and responds 200 if SERVING, 503 otherwise. Before Serve
+// has created the health server, it responds 200.
+func (s *Config) writeHealthStatus(w http.ResponseWriter, r *http.Request, service string) {
+	if s.healthServer == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	resp, err := s.healthServer.Check(r.Context(), &healthpb.HealthCheckRequest{Service: service})
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
 }
 
 func (s *Config) ServeMetrics() error {
 	s.Logger.Info(fmt.Sprintf("binding metrics to %s", s.MetricsPort))
-	s.metricsServer = &http.Server{
-		ReadHeaderTimeout: 3 * time.Second,
-		Addr:              fmt.Sprintf(":%s", s.MetricsPort),
-	}
-	s.metricsServer.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+	handler := auth.HTTPMiddleware(s.Auth, s.Logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
 		case "/healthz":
+			// Liveness only: the process is up and serving. A transient
+			// dependency outage shouldn't kill and restart an otherwise
+			// healthy process - that's what /readyz is for.
 			w.WriteHeader(http.StatusOK)
+		case "/readyz":
+			s.writeHealthStatus(w, r, "")
 		case "/metrics":
-			promhttp.Handler().ServeHTTP(w, r)
+			promhttp.HandlerFor(observability.Registry(), promhttp.HandlerOpts{}).ServeHTTP(w, r)
 		default:
 			w.WriteHeader(http.StatusNotFound)
 		}
-	})
-	if err := s.metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	}))
+
+	s.metricsServer = grpcutil.New(fmt.Sprintf(":%s", s.MetricsPort),
+		grpcutil.WithHTTPHandler(handler),
+		grpcutil.WithReadHeaderTimeout(3*time.Second),
+	)
+	lis, err := s.metricsServer.Listen()
+	if err != nil {
+		return err
+	}
+	if err := s.metricsServer.Run(context.Background(), lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
 	return nil
 }
 
 func (s *Config) ServeAlerts() error {
-	s.alertmanagerServer = &http.Server{
-		Addr: fmt.Sprintf(":%s", s.AlertmanagerPort),
+	ttl := s.AlertCacheTTL
+	if ttl <= 0 {
+		ttl = defaultAlertCacheTTL
 	}
-	s.alertmanagerServer.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Parse URL params.
-		params := r.URL.Query()
-
-		// Prepare AnalyzeRequest from URL params.
-		analyzeRequest := &schemav1.AnalyzeRequest{
-			Backend:  params.Get("backend"),
-			Language: params.Get("language"),
-			Filters:  params["filters"],
-			// TODO add later.
-			Nocache: true,
-			Explain: true,
-		}
-
-		// Extract Prometheus Alert payload.
-		log.Printf("extracting alert payload")
-		var alerts models.PostableAlerts
-		decoder := json.NewDecoder(r.Body)
-		err := decoder.Decode(&alerts)
-		if err != nil {
-			w.Write([]byte(fmt.Sprintf("decode alerts. err: %s", err)))
-			return
-		}
+	s.alertCache = newFingerprintCache(ttl)
 
-		annotation := params.Get("annotation")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/-/healthy", s.handleHealthy)
+	mux.HandleFunc("/-/ready", s.handleReady)
+	mux.HandleFunc("/", s.handleAlerts)
 
-		// For each Alert, analyze events.
-		for _, alert := range alerts {
-			if namespace, ok := alert.Labels["namespace"]; ok {
-				analyzeRequest.Namespace = namespace
-			}
-			if resp, err := s.AnalyzeHandler.Analyze(r.Context(), analyzeRequest); err != nil {
-				w.Write([]byte(fmt.Sprintf("analyze. err: %s", err)))
-				return
-			} else {
-				for _, result := range resp.Results {
-					alert.Annotations[annotation] = result.Details
-				}
-			}
-		}
+	handler := auth.HTTPMiddleware(s.Auth, s.Logger, mux)
 
-		// TODO Forward alert to original URI.
-	})
-	if err := s.alertmanagerServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	s.alertmanagerServer = grpcutil.New(fmt.Sprintf(":%s", s.AlertmanagerPort), grpcutil.WithHTTPHandler(handler))
+	lis, err := s.alertmanagerServer.Listen()
+	if err != nil {
+		return err
+	}
+	if err := s.alertmanagerServer.Run(context.Background(), lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
 	return nil